@@ -50,16 +50,23 @@ type beginTxer interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
-// Tx creates a new transaction in the Conn or DB in the context, and executes f with this transaction. It does a rollback if f returns an error, and returns that error. It will rollback and return nil if the error is ctxdb.Rollback. If f does not return an error, it will commit.
+// Tx creates a new transaction in the Conn or DB in the context, and executes f with this transaction. It does a rollback if f returns an error, and returns that error. It will rollback and return nil if the error is ctxdb.Rollback. If f does not return an error, it will commit. If ctx is already inside a Tx call, the nested call is converted into a SAVEPOINT instead of beginning a new transaction. Tx prefers the Databaser registered with WithTxDB, if any, as the source of the transaction, falling back to the Databaser registered with With. Hooks registered with AfterCommit or AfterRollback from within f run once the transaction has actually committed or rolled back; a panic in a hook is recovered and returned from Tx as an error, joined with f's error if there is one, so Tx can return a non-nil error after a commit or after a ctxdb.Rollback.
 func Tx(ctx context.Context, f func(ctx context.Context) error) error {
+	if InTx(ctx) {
+		return nestedTx(ctx, f)
+	}
+
 	db, ok := getDB(ctx)
 	if !ok {
 		return errMissingDB
 	}
 
-	txer, ok := db.(beginTxer)
+	txer, ok := getTxDB(ctx)
 	if !ok {
-		return errCantTx
+		txer, ok = db.(beginTxer)
+		if !ok {
+			return errCantTx
+		}
 	}
 
 	tx, err := txer.BeginTx(ctx, nil)
@@ -67,17 +74,31 @@ func Tx(ctx context.Context, f func(ctx context.Context) error) error {
 		return err
 	}
 
-	err = f(With(ctx, tx))
+	hooks := new(txHooks)
+	txCtx := context.WithValue(With(ctx, tx), inTxKey{}, true)
+	txCtx = context.WithValue(txCtx, savepointKey{}, new(int32))
+	txCtx = context.WithValue(txCtx, hooksKey{}, hooks)
+	txCtx = context.WithValue(txCtx, txIDKey{}, newTxID())
+
+	err = f(txCtx)
 	if err != nil {
 		tx.Rollback()
+		hookErr := hooks.runAfterRollback(err)
 		if err == Rollback {
-			return nil
+			return hookErr
+		}
+		if hookErr == nil {
+			return err
 		}
 
-		return err
+		return errors.Join(err, hookErr)
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	pinPrimaryAfterCommit(ctx)
+	return hooks.runAfterCommit()
 }
 
 // Exec executes a query without returning any rows. The args are for any placeholder parameters in the query.
@@ -89,20 +110,20 @@ func Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, e
 	return db.ExecContext(ctx, query, args...)
 }
 
-// Query executes a query that returns rows, typically a SELECT. The args are for any placeholder parameters in the query.
+// Query executes a query that returns rows, typically a SELECT. The args are for any placeholder parameters in the query. If a replica pool is registered with WithReplicas, Query is routed to a replica unless the call is made inside a Tx callback (it then uses the transaction) or is forced or pinned to the primary; see OnPrimary and WithPrimaryPinWindow.
 func Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	db, ok := getDB(ctx)
+	db, ok := pickReadDB(ctx)
 	if !ok {
 		return nil, errMissingDB
 	}
 	return db.QueryContext(ctx, query, args...)
 }
 
-// QueryRow executes a query that is expected to return at most one row. QueryRow always returns a non-nil value. Errors are deferred until Row's Scan method is called. If the query selects no rows, the *Row's Scan will return ErrNoRows. Otherwise, the *Row's Scan scans the first selected row and discards the rest.
+// QueryRow executes a query that is expected to return at most one row. QueryRow always returns a non-nil value. Errors are deferred until Row's Scan method is called. If the query selects no rows, the *Row's Scan will return ErrNoRows. Otherwise, the *Row's Scan scans the first selected row and discards the rest. Like Query, it is routed to a replica when one is registered, unless pinned or forced to the primary.
 func QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	db, ok := getDB(ctx)
+	db, ok := pickReadDB(ctx)
 	if !ok {
-		return (&row{err: errMissingDB}).intoDBRow()
+		return errorRow(ctx, errMissingDB)
 	}
 	return db.QueryRowContext(ctx, query, args...)
 }
@@ -0,0 +1,169 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeCall records a single ExecContext or QueryContext invocation reaching
+// the driver, after named args have been resolved to their values.
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeConn is a driver.Conn backing a single *sql.DB connection, used to
+// drive ctxdb's public entry points end-to-end without a real database.
+// Tests configure execFunc/queryFunc to control what ExecContext/QueryContext
+// return; the zero values are a no-op result and an empty row set.
+type fakeConn struct {
+	mu       sync.Mutex
+	execs    []fakeCall
+	queries  []fakeCall
+	execFunc func(query string, args []driver.Value) (driver.Result, error)
+	queryFunc func(query string, args []driver.Value) (driver.Rows, error)
+	pingErr  error
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: Prepare not supported, use ExecContext/QueryContext")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakeConn: Begin not supported, use BeginTx")
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	values := namedValuesToValues(args)
+	c.mu.Lock()
+	c.execs = append(c.execs, fakeCall{query: query, args: values})
+	c.mu.Unlock()
+
+	if c.execFunc != nil {
+		return c.execFunc(query, values)
+	}
+	return fakeResult{}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := namedValuesToValues(args)
+	c.mu.Lock()
+	c.queries = append(c.queries, fakeCall{query: query, args: values})
+	c.mu.Unlock()
+
+	if c.queryFunc != nil {
+		return c.queryFunc(query, values)
+	}
+	return &fakeRows{}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error { return c.pingErr }
+
+func (c *fakeConn) setPingErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pingErr = err
+}
+
+func (c *fakeConn) callLog() (execs, queries []fakeCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]fakeCall(nil), c.execs...), append([]fakeCall(nil), c.queries...)
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+type fakeResult struct {
+	lastInsertID, rowsAffected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// fakeRows is a canned driver.Rows over a fixed set of columns and values.
+type fakeRows struct {
+	cols []string
+	data [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.pos])
+	r.pos++
+	return nil
+}
+
+// fakeTx records COMMIT/ROLLBACK as entries in its conn's exec log, so tests
+// can observe transaction boundaries alongside ordinary statements.
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (t *fakeTx) Commit() error {
+	t.conn.mu.Lock()
+	t.conn.execs = append(t.conn.execs, fakeCall{query: "COMMIT"})
+	t.conn.mu.Unlock()
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.conn.mu.Lock()
+	t.conn.execs = append(t.conn.execs, fakeCall{query: "ROLLBACK"})
+	t.conn.mu.Unlock()
+	return nil
+}
+
+type fakeDriver struct {
+	conn *fakeConn
+}
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) {
+	return d.conn, nil
+}
+
+var fakeDriverCounter int64
+
+// newFakeDB registers a fresh fakeDriver under a unique name and opens a
+// *sql.DB against it, pinned to a single connection so that every call in a
+// test observes the same fakeConn's log in issue order.
+func newFakeDB(t *testing.T) (*sql.DB, *fakeConn) {
+	t.Helper()
+
+	conn := &fakeConn{}
+	name := fmt.Sprintf("ctxdb-fakedriver-%d", atomic.AddInt64(&fakeDriverCounter, 1))
+	sql.Register(name, fakeDriver{conn: conn})
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	return db, conn
+}
@@ -0,0 +1,89 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type hooksKey struct{}
+
+// txHooks holds the callbacks registered during a single Tx call via
+// AfterCommit and AfterRollback.
+type txHooks struct {
+	mu            sync.Mutex
+	afterCommit   []func()
+	afterRollback []func(error)
+}
+
+func getHooks(ctx context.Context) (*txHooks, bool) {
+	h, ok := ctx.Value(hooksKey{}).(*txHooks)
+	return h, ok
+}
+
+// AfterCommit registers fn to run after the enclosing Tx call's transaction
+// has committed. Callbacks run in the order they were registered; a panic in
+// one is recovered so the rest still run. AfterCommit is a no-op if ctx is
+// not inside a Tx call.
+func AfterCommit(ctx context.Context, fn func()) {
+	h, ok := getHooks(ctx)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.afterCommit = append(h.afterCommit, fn)
+	h.mu.Unlock()
+}
+
+// AfterRollback registers fn to run after the enclosing Tx call's
+// transaction has rolled back, including via the ctxdb.Rollback sentinel.
+// fn receives the error that caused the rollback (nil for ctxdb.Rollback).
+// Callbacks run in the order they were registered; a panic in one is
+// recovered so the rest still run. AfterRollback is a no-op if ctx is not
+// inside a Tx call.
+func AfterRollback(ctx context.Context, fn func(err error)) {
+	h, ok := getHooks(ctx)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.afterRollback = append(h.afterRollback, fn)
+	h.mu.Unlock()
+}
+
+func (h *txHooks) runAfterCommit() error {
+	var errs []error
+	for _, fn := range h.afterCommit {
+		if err := runHook(func() { fn() }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *txHooks) runAfterRollback(cause error) error {
+	if cause == Rollback {
+		cause = nil
+	}
+
+	var errs []error
+	for _, fn := range h.afterRollback {
+		if err := runHook(func() { fn(cause) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHook invokes fn, recovering and reporting any panic as an error so a
+// single misbehaving hook can't stop the rest from running.
+func runHook(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("ctxdb: hook panicked: %v", r)
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,140 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAfterCommitOutsideTxIsNoop(t *testing.T) {
+	called := false
+	AfterCommit(context.Background(), func() { called = true })
+	if called {
+		t.Fatal("AfterCommit callback ran outside of a Tx")
+	}
+}
+
+func TestAfterCommitRunsInFIFOOrder(t *testing.T) {
+	h := new(txHooks)
+	ctx := context.WithValue(context.Background(), hooksKey{}, h)
+
+	var order []int
+	AfterCommit(ctx, func() { order = append(order, 1) })
+	AfterCommit(ctx, func() { order = append(order, 2) })
+	AfterCommit(ctx, func() { order = append(order, 3) })
+
+	if err := h.runAfterCommit(); err != nil {
+		t.Fatalf("runAfterCommit() error = %v", err)
+	}
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("order = %v, want [1 2 3]", order)
+	}
+}
+
+func TestAfterCommitPanicRecoveredAndLaterHooksStillRun(t *testing.T) {
+	h := new(txHooks)
+	ctx := context.WithValue(context.Background(), hooksKey{}, h)
+
+	ran := false
+	AfterCommit(ctx, func() { panic("boom") })
+	AfterCommit(ctx, func() { ran = true })
+
+	err := h.runAfterCommit()
+	if err == nil {
+		t.Fatal("runAfterCommit() error = nil, want a recovered-panic error")
+	}
+	if !ran {
+		t.Fatal("hook registered after a panicking hook did not run")
+	}
+}
+
+func TestAfterCommitJoinsMultiplePanics(t *testing.T) {
+	h := new(txHooks)
+	ctx := context.WithValue(context.Background(), hooksKey{}, h)
+
+	AfterCommit(ctx, func() { panic("first") })
+	AfterCommit(ctx, func() { panic("second") })
+
+	err := h.runAfterCommit()
+	if err == nil {
+		t.Fatal("runAfterCommit() error = nil, want joined panic errors")
+	}
+	if !containsString(err.Error(), "first") || !containsString(err.Error(), "second") {
+		t.Fatalf("runAfterCommit() error = %q, want both panics mentioned", err.Error())
+	}
+}
+
+func TestAfterRollbackReceivesCause(t *testing.T) {
+	h := new(txHooks)
+	ctx := context.WithValue(context.Background(), hooksKey{}, h)
+
+	var got error
+	wantErr := errors.New("boom")
+	AfterRollback(ctx, func(err error) { got = err })
+
+	if err := h.runAfterRollback(wantErr); err != nil {
+		t.Fatalf("runAfterRollback() error = %v", err)
+	}
+	if got != wantErr {
+		t.Fatalf("AfterRollback saw %v, want %v", got, wantErr)
+	}
+}
+
+func TestAfterRollbackSentinelMapsToNilCause(t *testing.T) {
+	h := new(txHooks)
+	ctx := context.WithValue(context.Background(), hooksKey{}, h)
+
+	var got error = errors.New("untouched")
+	AfterRollback(ctx, func(err error) { got = err })
+
+	if err := h.runAfterRollback(Rollback); err != nil {
+		t.Fatalf("runAfterRollback() error = %v", err)
+	}
+	if got != nil {
+		t.Fatalf("AfterRollback saw %v for the Rollback sentinel, want nil", got)
+	}
+}
+
+func TestTxRunsAfterCommitHooksOnSuccess(t *testing.T) {
+	db, _ := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	ran := false
+	err := Tx(ctx, func(ctx context.Context) error {
+		AfterCommit(ctx, func() { ran = true })
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Tx() error = %v", err)
+	}
+	if !ran {
+		t.Fatal("AfterCommit hook did not run after a successful Tx")
+	}
+}
+
+func TestTxRunsAfterRollbackHooksWithCause(t *testing.T) {
+	db, _ := newFakeDB(t)
+	ctx := With(context.Background(), db)
+	wantErr := errors.New("boom")
+
+	var got error
+	err := Tx(ctx, func(ctx context.Context) error {
+		AfterRollback(ctx, func(err error) { got = err })
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Tx() error = %v, want it to wrap %v", err, wantErr)
+	}
+	if got != wantErr {
+		t.Fatalf("AfterRollback saw %v, want %v", got, wantErr)
+	}
+}
+
+func containsString(haystack, needle string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if haystack[i:i+len(needle)] == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"regexp"
+	"time"
+)
+
+// Middleware wraps a Databaser to add cross-cutting behavior — tracing,
+// metrics, logging — around every Exec, Query, and QueryRow call made
+// through it. A Middleware must forward BeginTx to next when next supports
+// it, so that a wrapped Databaser still works with Tx.
+type Middleware func(next Databaser) Databaser
+
+// WithMiddleware wraps the Databaser already registered in ctx with each
+// Middleware, in the order given, so that middlewares[0] ends up outermost
+// (it sees a call first and the resulting error/result last) and wraps
+// middlewares[1], and so on. It returns a context with the wrapped
+// Databaser installed via With. If ctx has no Databaser registered,
+// WithMiddleware returns ctx unchanged; the missing Databaser surfaces as
+// errMissingDB at the point a call is actually attempted, same as Exec,
+// Query, QueryRow, and Tx.
+func WithMiddleware(ctx context.Context, middlewares ...Middleware) context.Context {
+	db, ok := getDB(ctx)
+	if !ok {
+		return ctx
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		db = middlewares[i](db)
+	}
+	return With(ctx, db)
+}
+
+// middlewareDB adapts a wrapped Databaser plus a single around-call hook
+// into a Databaser, forwarding BeginTx to next when next supports it. start
+// returns the context to use for the call itself, so a hook that derives a
+// child context (e.g. one carrying a new span) can have that context reach
+// next.
+type middlewareDB struct {
+	next  Databaser
+	start func(ctx context.Context, query string, argCount int) (context.Context, func(err error))
+}
+
+func (m middlewareDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, end := m.start(ctx, query, len(args))
+	result, err := m.next.ExecContext(ctx, query, args...)
+	end(err)
+	return result, err
+}
+
+func (m middlewareDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, end := m.start(ctx, query, len(args))
+	rows, err := m.next.QueryContext(ctx, query, args...)
+	end(err)
+	return rows, err
+}
+
+// QueryRowContext instruments the call itself; any error from the query is
+// deferred until the returned *sql.Row is scanned, by which point the span
+// or log line this produced has already closed, so it always reports a nil
+// error.
+func (m middlewareDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, end := m.start(ctx, query, len(args))
+	row := m.next.QueryRowContext(ctx, query, args...)
+	end(nil)
+	return row
+}
+
+func (m middlewareDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	txer, ok := m.next.(beginTxer)
+	if !ok {
+		return nil, errCantTx
+	}
+	return txer.BeginTx(ctx, opts)
+}
+
+// opCommentPattern matches a leading "/* op=Name */" comment used to label a
+// query for metrics, e.g. "/* op=ListUsers */ SELECT ...".
+var opCommentPattern = regexp.MustCompile(`(?s)^\s*/\*\s*op=([A-Za-z0-9_.-]+)\s*\*/`)
+
+// queryOp extracts the op label from a leading "/* op=Name */" comment, or
+// returns "" if query has none.
+func queryOp(query string) string {
+	m := opCommentPattern.FindStringSubmatch(query)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// SpanAttributes describes a single database call for a Tracer.
+type SpanAttributes struct {
+	// Statement is the query text (db.statement).
+	Statement string
+	// System names the database system, e.g. "postgresql" (db.system).
+	System string
+	// TxID identifies the enclosing transaction, if any.
+	TxID string
+}
+
+// Tracer starts a span for a database call. The returned context is used
+// for the call itself (so nested spans parent correctly), and the returned
+// function ends the span, recording err if the call failed.
+type Tracer interface {
+	StartSpan(ctx context.Context, attrs SpanAttributes) (context.Context, func(err error))
+}
+
+// Tracing returns a Middleware that starts a span via tracer around every
+// Exec, Query, and QueryRow call, tagged with the query text, system, and
+// the id of the enclosing transaction, if any. The context StartSpan
+// returns is used for the call itself, so spans for queries issued further
+// down the stack parent correctly under it.
+func Tracing(tracer Tracer, system string) Middleware {
+	return func(next Databaser) Databaser {
+		return middlewareDB{
+			next: next,
+			start: func(ctx context.Context, query string, argCount int) (context.Context, func(err error)) {
+				txID, _ := getTxID(ctx)
+				return tracer.StartSpan(ctx, SpanAttributes{
+					Statement: query,
+					System:    system,
+					TxID:      txID,
+				})
+			},
+		}
+	}
+}
+
+// MetricsRecorder records the outcome of a single database call, labeled by
+// the op extracted from a leading "/* op=Name */" comment in the query (or
+// "" if the query has none).
+type MetricsRecorder interface {
+	ObserveQuery(op string, duration time.Duration, err error)
+}
+
+// Metrics returns a Middleware that reports the latency and outcome of
+// every Exec, Query, and QueryRow call to recorder, labeled by op.
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next Databaser) Databaser {
+		return middlewareDB{
+			next: next,
+			start: func(ctx context.Context, query string, argCount int) (context.Context, func(err error)) {
+				op := queryOp(query)
+				started := time.Now()
+				return ctx, func(err error) {
+					recorder.ObserveQuery(op, time.Since(started), err)
+				}
+			},
+		}
+	}
+}
+
+// SlowQueryLogger returns a Middleware that logs any Exec, Query, or
+// QueryRow call taking at least threshold, via logf (e.g. log.Printf). The
+// log line includes the query, the number of arguments, and the duration.
+func SlowQueryLogger(threshold time.Duration, logf func(format string, args ...interface{})) Middleware {
+	if logf == nil {
+		logf = log.Printf
+	}
+	return func(next Databaser) Databaser {
+		return middlewareDB{
+			next: next,
+			start: func(ctx context.Context, query string, argCount int) (context.Context, func(err error)) {
+				started := time.Now()
+				return ctx, func(err error) {
+					if dur := time.Since(started); dur >= threshold {
+						logf("ctxdb: slow query (%s, %d args): %s (err=%v)", dur, argCount, query, err)
+					}
+				}
+			},
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+type recordingDB struct {
+	beginTx func(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func (f *recordingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (f *recordingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (f *recordingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (f *recordingDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return f.beginTx(ctx, opts)
+}
+
+// labelMiddleware records "name:start" / "name:end" into order on every
+// call, so tests can observe wrapping order directly.
+func labelMiddleware(name string, order *[]string) Middleware {
+	return func(next Databaser) Databaser {
+		return middlewareDB{
+			next: next,
+			start: func(ctx context.Context, query string, argCount int) (context.Context, func(err error)) {
+				*order = append(*order, name+":start")
+				return ctx, func(err error) {
+					*order = append(*order, name+":end")
+				}
+			},
+		}
+	}
+}
+
+func TestWithMiddlewareFirstArgIsOutermost(t *testing.T) {
+	var order []string
+	ctx := With(context.Background(), &recordingDB{})
+	ctx = WithMiddleware(ctx, labelMiddleware("A", &order), labelMiddleware("B", &order))
+
+	if _, err := Exec(ctx, "SELECT 1"); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+
+	want := []string{"A:start", "B:start", "B:end", "A:end"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestMiddlewareForwardsBeginTxWhenSupported(t *testing.T) {
+	called := false
+	db := &recordingDB{
+		beginTx: func(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+			called = true
+			return nil, nil
+		},
+	}
+
+	var order []string
+	wrapped := labelMiddleware("A", &order)(db)
+
+	txer, ok := wrapped.(beginTxer)
+	if !ok {
+		t.Fatal("middleware-wrapped Databaser does not implement beginTxer")
+	}
+	if _, err := txer.BeginTx(context.Background(), nil); err != nil {
+		t.Fatalf("BeginTx() error = %v", err)
+	}
+	if !called {
+		t.Fatal("BeginTx was not forwarded to the wrapped Databaser")
+	}
+}
+
+type spanKey struct{}
+
+// fakeTracer derives a child context carrying the traced statement, so tests
+// can tell whether that child context reached the wrapped Databaser.
+type fakeTracer struct{}
+
+func (fakeTracer) StartSpan(ctx context.Context, attrs SpanAttributes) (context.Context, func(err error)) {
+	return context.WithValue(ctx, spanKey{}, attrs.Statement), func(err error) {}
+}
+
+func TestTracingPassesSpanContextToNext(t *testing.T) {
+	next := &capturingDB{}
+	wrapped := Tracing(fakeTracer{}, "postgresql")(next)
+
+	if _, err := wrapped.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+
+	if got, _ := next.ctx.Value(spanKey{}).(string); got != "SELECT 1" {
+		t.Fatalf("next saw ctx with span value %q, want the span context from StartSpan", got)
+	}
+}
+
+// capturingDB records the context each call was made with.
+type capturingDB struct {
+	ctx context.Context
+}
+
+func (c *capturingDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c.ctx = ctx
+	return nil, nil
+}
+
+func (c *capturingDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.ctx = ctx
+	return nil, nil
+}
+
+func (c *capturingDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c.ctx = ctx
+	return nil
+}
+
+type recordedObservation struct {
+	op       string
+	duration time.Duration
+	err      error
+}
+
+type fakeRecorder struct {
+	observations []recordedObservation
+}
+
+func (r *fakeRecorder) ObserveQuery(op string, duration time.Duration, err error) {
+	r.observations = append(r.observations, recordedObservation{op: op, duration: duration, err: err})
+}
+
+func TestMetricsObservesOpAndError(t *testing.T) {
+	recorder := &fakeRecorder{}
+	db := &recordingDB{}
+	wrapped := Metrics(recorder)(db)
+
+	if _, err := wrapped.ExecContext(context.Background(), "/* op=CreateUser */ INSERT INTO users ..."); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	if _, err := wrapped.QueryContext(context.Background(), "/* op=ListUsers */ SELECT ..."); err != nil {
+		t.Fatalf("QueryContext() error = %v", err)
+	}
+	_ = wrapped.QueryRowContext(context.Background(), "SELECT 1")
+
+	if len(recorder.observations) != 3 {
+		t.Fatalf("observations = %v, want 3", recorder.observations)
+	}
+	if recorder.observations[0].op != "CreateUser" {
+		t.Fatalf("observations[0].op = %q, want CreateUser", recorder.observations[0].op)
+	}
+	if recorder.observations[1].op != "ListUsers" {
+		t.Fatalf("observations[1].op = %q, want ListUsers", recorder.observations[1].op)
+	}
+	if recorder.observations[2].op != "" {
+		t.Fatalf("observations[2].op = %q, want empty for an un-labeled query", recorder.observations[2].op)
+	}
+}
+
+func TestSlowQueryLoggerOnlyLogsAboveThreshold(t *testing.T) {
+	var logged []string
+	logf := func(format string, args ...interface{}) {
+		logged = append(logged, format)
+	}
+
+	db := &recordingDB{}
+	wrapped := SlowQueryLogger(time.Hour, logf)(db)
+	if _, err := wrapped.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	if len(logged) != 0 {
+		t.Fatalf("logged = %v, want nothing below the threshold", logged)
+	}
+
+	wrapped = SlowQueryLogger(0, logf)(db)
+	if _, err := wrapped.ExecContext(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("ExecContext() error = %v", err)
+	}
+	if len(logged) != 1 {
+		t.Fatalf("logged = %v, want one entry at a zero threshold", logged)
+	}
+}
+
+func TestWithMiddlewareWithoutDatabaserDoesNotPanic(t *testing.T) {
+	var order []string
+	ctx := WithMiddleware(context.Background(), labelMiddleware("A", &order))
+
+	if _, err := Exec(ctx, "SELECT 1"); err != errMissingDB {
+		t.Fatalf("Exec() error = %v, want errMissingDB", err)
+	}
+	if len(order) != 0 {
+		t.Fatalf("order = %v, want no middleware to run without a Databaser", order)
+	}
+}
+
+func TestMiddlewareBeginTxErrorsWhenUnsupported(t *testing.T) {
+	db := &fakeDB{} // does not implement beginTxer
+	var order []string
+	wrapped := labelMiddleware("A", &order)(db)
+
+	txer, ok := wrapped.(beginTxer)
+	if !ok {
+		t.Fatal("middleware-wrapped Databaser does not implement beginTxer")
+	}
+	if _, err := txer.BeginTx(context.Background(), nil); err != errCantTx {
+		t.Fatalf("BeginTx() error = %v, want errCantTx", err)
+	}
+}
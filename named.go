@@ -0,0 +1,372 @@
+package ctxdb
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Dialect selects how named-parameter placeholders are rewritten into the
+// positional syntax a particular database driver expects.
+type Dialect int
+
+const (
+	// DialectQuestion rewrites named parameters to "?", as used by MySQL and SQLite.
+	DialectQuestion Dialect = iota
+	// DialectDollar rewrites named parameters to "$1", "$2", ..., as used by PostgreSQL.
+	DialectDollar
+	// DialectAt rewrites named parameters to "@p1", "@p2", ..., as used by SQL Server.
+	DialectAt
+)
+
+type dialectKey struct{}
+
+// WithDialect returns a new context that carries the Dialect used to rewrite
+// named queries for NamedExec, NamedQuery, and NamedQueryRow. If no Dialect
+// is set, DialectQuestion is used.
+func WithDialect(ctx context.Context, d Dialect) context.Context {
+	return context.WithValue(ctx, dialectKey{}, d)
+}
+
+func getDialect(ctx context.Context) Dialect {
+	d, ok := ctx.Value(dialectKey{}).(Dialect)
+	if !ok {
+		return DialectQuestion
+	}
+	return d
+}
+
+var errMissingNamedParam = errors.New("ctxdb: missing named parameter")
+
+// namedTemplate is the parsed form of a named query: the parameter names in
+// the order they appear, positionally matching the rewritten query's
+// placeholders.
+type namedTemplate struct {
+	names []string
+}
+
+type namedCacheKey struct {
+	query   string
+	dialect Dialect
+}
+
+type namedCacheEntry struct {
+	key       namedCacheKey
+	tmpl      *namedTemplate
+	rewritten string
+}
+
+// namedCache is a thread-safe, fixed-size LRU cache of parsed named query
+// templates, keyed by the raw query string and the dialect it was parsed
+// for.
+type namedCache struct {
+	size  int
+	mu    sync.Mutex
+	ll    *list.List
+	items map[namedCacheKey]*list.Element
+}
+
+func newNamedCache(size int) *namedCache {
+	return &namedCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[namedCacheKey]*list.Element, size),
+	}
+}
+
+func (c *namedCache) get(key namedCacheKey) (*namedTemplate, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, "", false
+	}
+	c.ll.MoveToFront(el)
+	entry := el.Value.(*namedCacheEntry)
+	return entry.tmpl, entry.rewritten, true
+}
+
+func (c *namedCache) put(key namedCacheKey, tmpl *namedTemplate, rewritten string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*namedCacheEntry).tmpl = tmpl
+		el.Value.(*namedCacheEntry).rewritten = rewritten
+		return
+	}
+
+	el := c.ll.PushFront(&namedCacheEntry{key: key, tmpl: tmpl, rewritten: rewritten})
+	c.items[key] = el
+	if c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*namedCacheEntry).key)
+		}
+	}
+}
+
+// namedQueryCacheSize bounds the number of distinct (query, dialect) pairs
+// kept parsed in memory at once.
+const namedQueryCacheSize = 512
+
+var namedQueryCache = newNamedCache(namedQueryCacheSize)
+
+// NamedExec is like Exec, but query may use "@Name" or ":name" placeholders
+// bound from arg, which must be a map[string]interface{} or a struct (see
+// NamedQuery for binding rules).
+func NamedExec(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	rewritten, args, err := bindNamed(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return Exec(ctx, rewritten, args...)
+}
+
+// NamedQuery is like Query, but query may use "@Name" or ":name"
+// placeholders instead of the driver's native positional syntax. arg
+// supplies the values, either as a map[string]interface{} keyed by
+// parameter name, or as a struct whose fields are matched by "db" tag or,
+// failing that, by the snake_case of the field name. Embedded structs and
+// pointer fields are followed. Placeholders are rewritten according to the
+// Dialect set on ctx via WithDialect, and the parsed placeholder positions
+// and rewritten SQL are cached so repeated calls with the same query and
+// dialect skip re-parsing. A parameter referenced in the query but missing
+// from arg is reported as an error before the query is sent.
+func NamedQuery(ctx context.Context, query string, arg interface{}) (*sql.Rows, error) {
+	rewritten, args, err := bindNamed(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return Query(ctx, rewritten, args...)
+}
+
+// NamedQueryRow is like QueryRow, but query may use "@Name" or ":name"
+// placeholders; see NamedQuery for binding rules.
+func NamedQueryRow(ctx context.Context, query string, arg interface{}) *sql.Row {
+	rewritten, args, err := bindNamed(ctx, query, arg)
+	if err != nil {
+		return errorRow(ctx, err)
+	}
+	return QueryRow(ctx, rewritten, args...)
+}
+
+func bindNamed(ctx context.Context, query string, arg interface{}) (string, []interface{}, error) {
+	dialect := getDialect(ctx)
+	key := namedCacheKey{query: query, dialect: dialect}
+
+	tmpl, rewritten, ok := namedQueryCache.get(key)
+	if !ok {
+		names, r := parseNamed(query, dialect)
+		tmpl = &namedTemplate{names: names}
+		rewritten = r
+		namedQueryCache.put(key, tmpl, rewritten)
+	}
+
+	values, err := namedValues(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := make([]interface{}, len(tmpl.names))
+	for i, name := range tmpl.names {
+		v, ok := values[name]
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %q", errMissingNamedParam, name)
+		}
+		args[i] = v
+	}
+	return rewritten, args, nil
+}
+
+// parseNamed scans query for "@Name" or ":name" placeholders, skipping over
+// quoted string literals and -- / * comments so that '@' and ':' appearing
+// inside them are left untouched (a bare "::" cast is also left alone). It
+// returns the parameter names in the order encountered and the query
+// rewritten with dialect's positional placeholder syntax.
+func parseNamed(query string, dialect Dialect) ([]string, string) {
+	var names []string
+	var out strings.Builder
+
+	runes := []rune(query)
+	n := len(runes)
+	for i := 0; i < n; {
+		c := runes[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := skipLiteral(runes, i)
+			out.WriteString(string(runes[i:j]))
+			i = j
+		case c == '-' && i+1 < n && runes[i+1] == '-':
+			j := skipLineComment(runes, i)
+			out.WriteString(string(runes[i:j]))
+			i = j
+		case c == '/' && i+1 < n && runes[i+1] == '*':
+			j := skipBlockComment(runes, i)
+			out.WriteString(string(runes[i:j]))
+			i = j
+		case c == ':' && i+1 < n && runes[i+1] == ':':
+			out.WriteString("::")
+			i += 2
+		case (c == '@' || c == ':') && i+1 < n && isIdentStart(runes[i+1]):
+			j := i + 1
+			for j < n && isIdentPart(runes[j]) {
+				j++
+			}
+			name := string(runes[i+1 : j])
+			names = append(names, name)
+			out.WriteString(placeholder(dialect, len(names)))
+			i = j
+		default:
+			out.WriteRune(c)
+			i++
+		}
+	}
+	return names, out.String()
+}
+
+func placeholder(dialect Dialect, n int) string {
+	switch dialect {
+	case DialectDollar:
+		return fmt.Sprintf("$%d", n)
+	case DialectAt:
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return "?"
+	}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func skipLiteral(runes []rune, i int) int {
+	quote := runes[i]
+	j := i + 1
+	for j < len(runes) {
+		if runes[j] == quote {
+			if j+1 < len(runes) && runes[j+1] == quote {
+				j += 2
+				continue
+			}
+			return j + 1
+		}
+		j++
+	}
+	return j
+}
+
+func skipLineComment(runes []rune, i int) int {
+	j := i
+	for j < len(runes) && runes[j] != '\n' {
+		j++
+	}
+	return j
+}
+
+func skipBlockComment(runes []rune, i int) int {
+	j := i + 2
+	for j+1 < len(runes) {
+		if runes[j] == '*' && runes[j+1] == '/' {
+			return j + 2
+		}
+		j++
+	}
+	return len(runes)
+}
+
+// namedValues extracts a name -> value map from arg, which must be a
+// map[string]interface{} or a struct (optionally behind pointers).
+func namedValues(arg interface{}) (map[string]interface{}, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		return m, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, errors.New("ctxdb: nil struct pointer passed as named argument")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ctxdb: named argument must be a map[string]interface{} or struct, got %T", arg)
+	}
+
+	values := make(map[string]interface{})
+	collectStructFields(v, values)
+	return values, nil
+}
+
+func collectStructFields(v reflect.Value, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		if f.Anonymous {
+			fv := v.Field(i)
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv = reflect.Value{}
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				collectStructFields(fv, values)
+				continue
+			}
+		}
+
+		name := structFieldName(f)
+		if name == "-" {
+			continue
+		}
+		values[name] = v.Field(i).Interface()
+	}
+}
+
+// structFieldName returns the name a struct field is bound under: the
+// "db" tag if present, otherwise the snake_case of the field name.
+func structFieldName(f reflect.StructField) string {
+	if tag, ok := f.Tag.Lookup("db"); ok {
+		if i := strings.Index(tag, ","); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag != "" {
+			return tag
+		}
+	}
+	return toSnakeCase(f.Name)
+}
+
+func toSnakeCase(s string) string {
+	var out strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				out.WriteByte('_')
+			}
+			out.WriteRune(unicode.ToLower(r))
+		} else {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
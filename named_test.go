@@ -0,0 +1,198 @@
+package ctxdb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseNamed(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		dialect   Dialect
+		wantNames []string
+		wantSQL   string
+	}{
+		{
+			name:      "question mark dialect",
+			query:     "SELECT * FROM users WHERE id = @id AND name = :name",
+			dialect:   DialectQuestion,
+			wantNames: []string{"id", "name"},
+			wantSQL:   "SELECT * FROM users WHERE id = ? AND name = ?",
+		},
+		{
+			name:      "dollar dialect",
+			query:     "SELECT * FROM users WHERE id = @id AND name = :name",
+			dialect:   DialectDollar,
+			wantNames: []string{"id", "name"},
+			wantSQL:   "SELECT * FROM users WHERE id = $1 AND name = $2",
+		},
+		{
+			name:      "at dialect",
+			query:     "SELECT * FROM users WHERE id = :id",
+			dialect:   DialectAt,
+			wantNames: []string{"id"},
+			wantSQL:   "SELECT * FROM users WHERE id = @p1",
+		},
+		{
+			name:      "ignores params inside single-quoted literal",
+			query:     "SELECT * FROM users WHERE note = ':not_a_param' AND id = :id",
+			dialect:   DialectQuestion,
+			wantNames: []string{"id"},
+			wantSQL:   "SELECT * FROM users WHERE note = ':not_a_param' AND id = ?",
+		},
+		{
+			name:      "ignores params inside double-quoted identifier",
+			query:     `SELECT "@weird_column" FROM users WHERE id = @id`,
+			dialect:   DialectQuestion,
+			wantNames: []string{"id"},
+			wantSQL:   `SELECT "@weird_column" FROM users WHERE id = ?`,
+		},
+		{
+			name:      "ignores params inside line comment",
+			query:     "SELECT * FROM users -- skip :not_a_param\nWHERE id = :id",
+			dialect:   DialectQuestion,
+			wantNames: []string{"id"},
+			wantSQL:   "SELECT * FROM users -- skip :not_a_param\nWHERE id = ?",
+		},
+		{
+			name:      "ignores params inside block comment",
+			query:     "SELECT * FROM users /* skip @not_a_param */ WHERE id = @id",
+			dialect:   DialectQuestion,
+			wantNames: []string{"id"},
+			wantSQL:   "SELECT * FROM users /* skip @not_a_param */ WHERE id = ?",
+		},
+		{
+			name:      "leaves double-colon casts alone",
+			query:     "SELECT id::text FROM users WHERE id = :id",
+			dialect:   DialectQuestion,
+			wantNames: []string{"id"},
+			wantSQL:   "SELECT id::text FROM users WHERE id = ?",
+		},
+		{
+			name:      "repeated parameter gets a placeholder per occurrence",
+			query:     "SELECT * FROM users WHERE id = :id OR parent_id = :id",
+			dialect:   DialectDollar,
+			wantNames: []string{"id", "id"},
+			wantSQL:   "SELECT * FROM users WHERE id = $1 OR parent_id = $2",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, sql := parseNamed(tc.query, tc.dialect)
+			if !reflect.DeepEqual(names, tc.wantNames) {
+				t.Errorf("names = %v, want %v", names, tc.wantNames)
+			}
+			if sql != tc.wantSQL {
+				t.Errorf("rewritten = %q, want %q", sql, tc.wantSQL)
+			}
+		})
+	}
+}
+
+func TestNamedValuesFromStructAndMap(t *testing.T) {
+	type Address struct {
+		City string
+	}
+	type User struct {
+		Address
+		ID   int    `db:"id"`
+		Name string
+	}
+
+	values, err := namedValues(User{Address: Address{City: "nyc"}, ID: 1, Name: "bouk"})
+	if err != nil {
+		t.Fatalf("namedValues() error = %v", err)
+	}
+	if values["id"] != 1 || values["name"] != "bouk" || values["city"] != "nyc" {
+		t.Fatalf("namedValues() = %+v", values)
+	}
+
+	m := map[string]interface{}{"id": 2}
+	values, err = namedValues(m)
+	if err != nil {
+		t.Fatalf("namedValues() error = %v", err)
+	}
+	if values["id"] != 2 {
+		t.Fatalf("namedValues() = %+v", values)
+	}
+}
+
+func TestBindNamedMissingParam(t *testing.T) {
+	_, _, err := bindNamed(context.Background(), "SELECT * FROM users WHERE id = :id", map[string]interface{}{})
+	if err == nil {
+		t.Fatal("bindNamed() error = nil, want missing parameter error")
+	}
+}
+
+func TestNamedExecReachesDriverWithPositionalArgs(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	_, err := NamedExec(ctx, "UPDATE users SET name = :name WHERE id = :id", map[string]interface{}{
+		"id": 1, "name": "bouk",
+	})
+	if err != nil {
+		t.Fatalf("NamedExec() error = %v", err)
+	}
+
+	execs, _ := conn.callLog()
+	if len(execs) != 1 {
+		t.Fatalf("execs = %v, want exactly one", execs)
+	}
+	if execs[0].query != "UPDATE users SET name = ? WHERE id = ?" {
+		t.Fatalf("query = %q, want rewritten positional placeholders", execs[0].query)
+	}
+	if len(execs[0].args) != 2 || execs[0].args[0] != "bouk" || execs[0].args[1] != int64(1) {
+		t.Fatalf("args = %v, want [bouk 1]", execs[0].args)
+	}
+}
+
+func TestNamedExecMissingParamNeverReachesDriver(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	_, err := NamedExec(ctx, "UPDATE users SET name = :name WHERE id = :id", map[string]interface{}{"id": 1})
+	if err == nil {
+		t.Fatal("NamedExec() error = nil, want missing parameter error")
+	}
+
+	execs, _ := conn.callLog()
+	if len(execs) != 0 {
+		t.Fatalf("execs = %v, want none: the query should never reach the driver", execs)
+	}
+}
+
+func TestNamedQueryReachesDriverWithPositionalArgs(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	rows, err := NamedQuery(ctx, "SELECT id FROM users WHERE name = :name", map[string]interface{}{"name": "bouk"})
+	if err != nil {
+		t.Fatalf("NamedQuery() error = %v", err)
+	}
+	rows.Close()
+
+	_, queries := conn.callLog()
+	if len(queries) != 1 || queries[0].query != "SELECT id FROM users WHERE name = ?" {
+		t.Fatalf("queries = %v, want one rewritten query", queries)
+	}
+}
+
+func TestNamedQueryRowMissingParamReturnsUsableRow(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	row := NamedQueryRow(ctx, "SELECT id FROM users WHERE id = :id", map[string]interface{}{})
+	var dest int
+	if err := row.Scan(&dest); err == nil {
+		t.Fatal("Scan() error = nil, want missing parameter error")
+	}
+
+	_, queries := conn.callLog()
+	if len(queries) != 0 {
+		t.Fatalf("queries = %v, want none: the query should never reach the driver", queries)
+	}
+}
@@ -0,0 +1,241 @@
+package ctxdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type primaryKey struct{}
+
+// WithPrimary registers db as both the primary Databaser (as With does) and
+// as the primary for read/write splitting: Exec and Tx always use it, and
+// Query/QueryRow fall back to it whenever no replica pool is registered, no
+// replica is currently healthy, or the call is pinned to the primary (see
+// OnPrimary and WithPrimaryPinWindow).
+func WithPrimary(ctx context.Context, db Databaser) context.Context {
+	ctx = With(ctx, db)
+	return context.WithValue(ctx, primaryKey{}, db)
+}
+
+func getPrimary(ctx context.Context) (Databaser, bool) {
+	db, ok := ctx.Value(primaryKey{}).(Databaser)
+	return db, ok
+}
+
+// Replica is a single read replica registered with WithReplicas.
+type Replica struct {
+	DB Databaser
+	// Weight biases how often this replica is chosen relative to the
+	// others in the same pool; a replica with Weight 2 is picked roughly
+	// twice as often as one with Weight 1. Weight <= 0 is treated as 1.
+	Weight int
+}
+
+type replicaEntry struct {
+	db      Databaser
+	weight  int
+	healthy atomic.Bool
+}
+
+func pingable(db Databaser) (interface {
+	PingContext(ctx context.Context) error
+}, bool) {
+	p, ok := db.(interface {
+		PingContext(ctx context.Context) error
+	})
+	return p, ok
+}
+
+// ReplicaPool is a set of read replicas routed to with weighted
+// round-robin, skipping any replica that has failed its most recent health
+// check. Construct one with NewReplicaPool and register it per-request
+// with WithReplicas.
+type ReplicaPool struct {
+	entries  []*replicaEntry
+	rotation atomic.Value // []*replicaEntry
+	next     uint64
+	stop     chan struct{}
+}
+
+// NewReplicaPool builds a ReplicaPool from replicas. If interval is greater
+// than zero, it starts one goroutine per replica that pings it every
+// interval (replicas that don't implement PingContext are always
+// considered healthy), removing it from rotation on failure and re-adding
+// it once it responds again. Call Close to stop the health checks.
+func NewReplicaPool(interval time.Duration, replicas ...Replica) *ReplicaPool {
+	p := &ReplicaPool{stop: make(chan struct{})}
+	for _, r := range replicas {
+		weight := r.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		entry := &replicaEntry{db: r.DB, weight: weight}
+		entry.healthy.Store(true)
+		p.entries = append(p.entries, entry)
+	}
+	p.rebuildRotation()
+
+	if interval > 0 {
+		for _, entry := range p.entries {
+			go p.healthCheckLoop(entry, interval)
+		}
+	}
+	return p
+}
+
+func (p *ReplicaPool) healthCheckLoop(entry *replicaEntry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			healthy := true
+			if pinger, ok := pingable(entry.db); ok {
+				healthy = pinger.PingContext(context.Background()) == nil
+			}
+			if entry.healthy.Swap(healthy) != healthy {
+				p.rebuildRotation()
+			}
+		}
+	}
+}
+
+func (p *ReplicaPool) rebuildRotation() {
+	var flat []*replicaEntry
+	for _, entry := range p.entries {
+		if !entry.healthy.Load() {
+			continue
+		}
+		for i := 0; i < entry.weight; i++ {
+			flat = append(flat, entry)
+		}
+	}
+	p.rotation.Store(flat)
+}
+
+// pick returns the next replica in the weighted round-robin rotation, or
+// nil if none are currently healthy.
+func (p *ReplicaPool) pick() Databaser {
+	flat, _ := p.rotation.Load().([]*replicaEntry)
+	if len(flat) == 0 {
+		return nil
+	}
+	i := atomic.AddUint64(&p.next, 1)
+	return flat[i%uint64(len(flat))].db
+}
+
+// Close stops the pool's health-check goroutines. It does not close the
+// underlying replica connections.
+func (p *ReplicaPool) Close() {
+	close(p.stop)
+}
+
+type replicaPoolKey struct{}
+
+// WithReplicas registers pool as the read-replica pool for ctx. Query and
+// QueryRow use it by default, falling back to the primary registered with
+// WithPrimary when no replica is healthy.
+func WithReplicas(ctx context.Context, pool *ReplicaPool) context.Context {
+	if _, ok := ctx.Value(pinStateKey{}).(*pinState); !ok {
+		ctx = context.WithValue(ctx, pinStateKey{}, new(pinState))
+	}
+	return context.WithValue(ctx, replicaPoolKey{}, pool)
+}
+
+func getReplicaPool(ctx context.Context) (*ReplicaPool, bool) {
+	pool, ok := ctx.Value(replicaPoolKey{}).(*ReplicaPool)
+	return pool, ok
+}
+
+type onPrimaryKey struct{}
+
+// OnPrimary returns a context in which every Query or QueryRow call made with
+// it is forced onto the primary instead of a replica, e.g. to read your own
+// writes immediately after a commit.
+func OnPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, onPrimaryKey{}, true)
+}
+
+func isOnPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(onPrimaryKey{}).(bool)
+	return v
+}
+
+type pinWindowKey struct{}
+
+// WithPrimaryPinWindow sets how long Query and QueryRow are automatically
+// pinned to the primary after a Tx using ctx commits, so code that reads
+// immediately after writing doesn't see stale replica data. The default is
+// zero, meaning no automatic pinning.
+func WithPrimaryPinWindow(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, pinWindowKey{}, d)
+}
+
+func getPinWindow(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(pinWindowKey{}).(time.Duration)
+	return d
+}
+
+type pinStateKey struct{}
+
+// pinState tracks, for a given request context, how long reads should stay
+// pinned to the primary following a recent commit.
+type pinState struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (p *pinState) pin(d time.Duration) {
+	p.mu.Lock()
+	p.until = time.Now().Add(d)
+	p.mu.Unlock()
+}
+
+func (p *pinState) active() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().Before(p.until)
+}
+
+// pinPrimaryAfterCommit pins ctx's reads to the primary for ctx's
+// WithPrimaryPinWindow, if any, called after a Tx using ctx commits.
+func pinPrimaryAfterCommit(ctx context.Context) {
+	window := getPinWindow(ctx)
+	if window <= 0 {
+		return
+	}
+	if ps, ok := ctx.Value(pinStateKey{}).(*pinState); ok {
+		ps.pin(window)
+	}
+}
+
+func isPrimaryPinned(ctx context.Context) bool {
+	ps, ok := ctx.Value(pinStateKey{}).(*pinState)
+	return ok && ps.active()
+}
+
+// pickReadDB chooses the Databaser a read should use: the transaction when
+// ctx is inside a Tx callback, otherwise a replica, unless the call is forced
+// or pinned to the primary, no pool is registered, or no replica is currently
+// healthy.
+func pickReadDB(ctx context.Context) (Databaser, bool) {
+	if InTx(ctx) {
+		return getDB(ctx)
+	}
+	if !isOnPrimary(ctx) && !isPrimaryPinned(ctx) {
+		if pool, ok := getReplicaPool(ctx); ok {
+			if db := pool.pick(); db != nil {
+				return db, true
+			}
+		}
+	}
+	if db, ok := getPrimary(ctx); ok {
+		return db, true
+	}
+	return getDB(ctx)
+}
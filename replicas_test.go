@@ -0,0 +1,195 @@
+package ctxdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pingableDB is a Databaser that also implements PingContext, with a
+// mutex-guarded error so a test can flip its health between health checks.
+type pingableDB struct {
+	fakeDB
+	mu  sync.Mutex
+	err error
+}
+
+func (p *pingableDB) PingContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *pingableDB) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func TestReplicaPoolWeightedRotation(t *testing.T) {
+	light := &fakeDB{}
+	heavy := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: light, Weight: 1}, Replica{DB: heavy, Weight: 3})
+
+	counts := map[Databaser]int{}
+	const rounds = 40
+	for i := 0; i < rounds; i++ {
+		counts[pool.pick()]++
+	}
+
+	if counts[light] == 0 || counts[heavy] == 0 {
+		t.Fatalf("expected both replicas to be picked, got %v", counts)
+	}
+	// heavy has 3x the weight of light, so over many rounds it should be
+	// picked roughly 3x as often.
+	ratio := float64(counts[heavy]) / float64(counts[light])
+	if ratio < 2 || ratio > 4 {
+		t.Fatalf("heavy/light pick ratio = %.2f, want close to 3", ratio)
+	}
+}
+
+func TestReplicaPoolSkipsUnhealthyReplicas(t *testing.T) {
+	a := &fakeDB{}
+	b := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: a}, Replica{DB: b})
+
+	pool.entries[0].healthy.Store(false)
+	pool.rebuildRotation()
+
+	for i := 0; i < 10; i++ {
+		if pool.pick() != Databaser(b) {
+			t.Fatalf("pick() returned the unhealthy replica")
+		}
+	}
+}
+
+func TestReplicaPoolPickReturnsNilWhenAllUnhealthy(t *testing.T) {
+	a := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: a})
+	pool.entries[0].healthy.Store(false)
+	pool.rebuildRotation()
+
+	if got := pool.pick(); got != nil {
+		t.Fatalf("pick() = %v, want nil", got)
+	}
+}
+
+func TestPickReadDBPrefersReplicaOverPrimary(t *testing.T) {
+	primary := &fakeDB{}
+	replica := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: replica})
+
+	ctx := WithPrimary(context.Background(), primary)
+	ctx = WithReplicas(ctx, pool)
+
+	db, ok := pickReadDB(ctx)
+	if !ok || db != Databaser(replica) {
+		t.Fatalf("pickReadDB() = %v, %v, want the replica", db, ok)
+	}
+}
+
+func TestPickReadDBOnPrimaryForcesPrimary(t *testing.T) {
+	primary := &fakeDB{}
+	replica := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: replica})
+
+	ctx := WithPrimary(context.Background(), primary)
+	ctx = WithReplicas(ctx, pool)
+	ctx = OnPrimary(ctx)
+
+	db, ok := pickReadDB(ctx)
+	if !ok || db != Databaser(primary) {
+		t.Fatalf("pickReadDB() = %v, %v, want the primary", db, ok)
+	}
+}
+
+func TestPickReadDBFallsBackWhenNoReplicasHealthy(t *testing.T) {
+	primary := &fakeDB{}
+	replica := &fakeDB{}
+	pool := NewReplicaPool(0, Replica{DB: replica})
+	pool.entries[0].healthy.Store(false)
+	pool.rebuildRotation()
+
+	ctx := WithPrimary(context.Background(), primary)
+	ctx = WithReplicas(ctx, pool)
+
+	db, ok := pickReadDB(ctx)
+	if !ok || db != Databaser(primary) {
+		t.Fatalf("pickReadDB() = %v, %v, want the primary when no replica is healthy", db, ok)
+	}
+}
+
+func TestPickReadDBFallsBackToPlainDatabaser(t *testing.T) {
+	main := &fakeDB{}
+	ctx := With(context.Background(), main)
+
+	db, ok := pickReadDB(ctx)
+	if !ok || db != Databaser(main) {
+		t.Fatalf("pickReadDB() = %v, %v, want the plain registered Databaser", db, ok)
+	}
+}
+
+func TestPrimaryPinWindowPinsReadsAfterCommit(t *testing.T) {
+	pool := NewReplicaPool(0, Replica{DB: &fakeDB{}})
+	ctx := WithReplicas(context.Background(), pool)
+	ctx = WithPrimaryPinWindow(ctx, time.Minute)
+
+	if isPrimaryPinned(ctx) {
+		t.Fatal("isPrimaryPinned() = true before any commit")
+	}
+
+	pinPrimaryAfterCommit(ctx)
+
+	if !isPrimaryPinned(ctx) {
+		t.Fatal("isPrimaryPinned() = false after a commit within the pin window")
+	}
+}
+
+func TestPrimaryPinWindowDefaultIsNoPinning(t *testing.T) {
+	pool := NewReplicaPool(0, Replica{DB: &fakeDB{}})
+	ctx := WithReplicas(context.Background(), pool)
+
+	pinPrimaryAfterCommit(ctx)
+
+	if isPrimaryPinned(ctx) {
+		t.Fatal("isPrimaryPinned() = true with no WithPrimaryPinWindow set")
+	}
+}
+
+func TestReplicaPoolHealthCheckRemovesAndReAddsReplica(t *testing.T) {
+	replica := &pingableDB{}
+	pool := NewReplicaPool(5*time.Millisecond, Replica{DB: replica})
+	defer pool.Close()
+
+	if pool.pick() == nil {
+		t.Fatal("pick() = nil before any failed health check")
+	}
+
+	replica.setErr(errors.New("connection refused"))
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && pool.pick() != nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pool.pick() != nil {
+		t.Fatal("pick() did not remove the replica after it started failing its health check")
+	}
+
+	replica.setErr(nil)
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && pool.pick() == nil {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pool.pick() == nil {
+		t.Fatal("pick() did not re-add the replica after it started passing its health check again")
+	}
+}
+
+func TestQueryRowMissingDBStillReturnsUsableRow(t *testing.T) {
+	r := QueryRow(context.Background(), "SELECT 1")
+	var dest int
+	if err := r.Scan(&dest); err != errMissingDB {
+		t.Fatalf("Scan() error = %v, want errMissingDB", err)
+	}
+}
@@ -0,0 +1,42 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+)
+
+// errConnector is a driver.Connector whose Connect always fails with the
+// preset err, so that querying through it yields a real *sql.Row carrying
+// err, built by database/sql itself rather than by reinterpreting its
+// private fields.
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errConnector) Driver() driver.Driver {
+	return errConnectorDriver{}
+}
+
+// errConnectorDriver only exists to satisfy driver.Connector.Driver; Open is
+// never called because sql.OpenDB talks to the Connector directly.
+type errConnectorDriver struct{}
+
+func (errConnectorDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("ctxdb: errConnectorDriver.Open should not be called")
+}
+
+// errorRow returns a *sql.Row whose Scan always returns err, for call sites
+// (QueryRow, NamedQueryRow) that must fail before ever reaching a driver but
+// still need to return database/sql's concrete *Row type, which has no
+// exported constructor for this case.
+func errorRow(ctx context.Context, err error) *sql.Row {
+	db := sql.OpenDB(errConnector{err: err})
+	defer db.Close()
+	return db.QueryRowContext(ctx, "")
+}
@@ -0,0 +1,16 @@
+package ctxdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestErrorRowCarriesError(t *testing.T) {
+	want := errMissingDB
+	r := errorRow(context.Background(), want)
+
+	var dest int
+	if err := r.Scan(&dest); err != want {
+		t.Fatalf("Scan error = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,187 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var errScanDestination = errors.New("ctxdb: dest must be a non-nil pointer")
+
+type fieldMapKey struct {
+	typ     reflect.Type
+	columns string
+}
+
+// fieldMapCache maps a (struct type, column-set) pair to the field index
+// path each column scans into, so repeated Get/Select calls against the
+// same struct and result shape skip re-deriving the mapping by reflection.
+var fieldMapCache sync.Map // fieldMapKey -> [][]int
+
+// Get runs query against the Databaser in ctx and scans the first resulting
+// row into dest, which must be a pointer to a struct. Columns are matched to
+// fields by "db" tag, falling back to the snake_case of the field name;
+// embedded structs are searched recursively. It returns sql.ErrNoRows if the
+// query returns no rows.
+func Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	rows, err := Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errScanDestination
+	}
+
+	return scanRowInto(rows, v.Elem())
+}
+
+// Select runs query against the Databaser in ctx and scans all resulting
+// rows into dest, which must be a pointer to a slice of structs (or of
+// pointers to structs). See Get for column-to-field matching rules.
+func Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	rows, err := Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errScanDestination
+	}
+	slice := v.Elem()
+	if slice.Kind() != reflect.Slice {
+		return fmt.Errorf("ctxdb: dest must be a pointer to a slice, got %T", dest)
+	}
+	elemType := slice.Type().Elem()
+
+	for rows.Next() {
+		elemPtr := reflect.New(derefType(elemType))
+		if err := scanRowInto(rows, elemPtr.Elem()); err != nil {
+			return err
+		}
+
+		if elemType.Kind() == reflect.Ptr {
+			slice.Set(reflect.Append(slice, elemPtr))
+		} else {
+			slice.Set(reflect.Append(slice, elemPtr.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func scanRowInto(rows *sql.Rows, dest reflect.Value) error {
+	if dest.Kind() != reflect.Struct {
+		return fmt.Errorf("ctxdb: scan destination must be a struct, got %s", dest.Kind())
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	indexes, err := fieldIndexes(dest.Type(), columns)
+	if err != nil {
+		return err
+	}
+
+	targets := make([]interface{}, len(columns))
+	for i, idx := range indexes {
+		targets[i] = fieldByIndex(dest, idx).Addr().Interface()
+	}
+	return rows.Scan(targets...)
+}
+
+// fieldIndexes returns, for each column, the field index path into typ that
+// it should be scanned into (suitable for reflect.Value.FieldByIndex).
+// Results are cached per (type, column-set) pair.
+func fieldIndexes(typ reflect.Type, columns []string) ([][]int, error) {
+	key := fieldMapKey{typ: typ, columns: strings.Join(columns, ",")}
+	if cached, ok := fieldMapCache.Load(key); ok {
+		return cached.([][]int), nil
+	}
+
+	names := structFieldIndex(typ, nil, make(map[string][]int))
+	indexes := make([][]int, len(columns))
+	for i, col := range columns {
+		idx, ok := names[col]
+		if !ok {
+			return nil, fmt.Errorf("ctxdb: no field for column %q in %s", col, typ)
+		}
+		indexes[i] = idx
+	}
+
+	fieldMapCache.Store(key, indexes)
+	return indexes, nil
+}
+
+// structFieldIndex walks typ, and any embedded structs within it, collecting
+// a column name -> field index path map. Shallower fields take precedence
+// over same-named fields found through embedding, regardless of the
+// embedded field's position in typ's declaration order: typ's own fields
+// are all registered before any embedded struct is walked.
+func structFieldIndex(typ reflect.Type, prefix []int, out map[string][]int) map[string][]int {
+	var embeddedTypes []reflect.Type
+	var embeddedIndexes [][]int
+
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		index := append(append([]int{}, prefix...), i)
+		if f.Anonymous && derefType(f.Type).Kind() == reflect.Struct {
+			embeddedTypes = append(embeddedTypes, derefType(f.Type))
+			embeddedIndexes = append(embeddedIndexes, index)
+			continue
+		}
+
+		name := structFieldName(f)
+		if name == "-" {
+			continue
+		}
+		if _, exists := out[name]; !exists {
+			out[name] = index
+		}
+	}
+
+	for i, t := range embeddedTypes {
+		structFieldIndex(t, embeddedIndexes[i], out)
+	}
+	return out
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,173 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func TestStructFieldIndexEmbeddedAndTags(t *testing.T) {
+	type Address struct {
+		City string
+		Zip  string `db:"zip_code"`
+	}
+	type User struct {
+		Address
+		ID   int `db:"id"`
+		Name string
+	}
+
+	out := structFieldIndex(reflect.TypeOf(User{}), nil, make(map[string][]int))
+
+	want := map[string][]int{
+		"id":       {1},
+		"name":     {2},
+		"city":     {0, 0},
+		"zip_code": {0, 1},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("structFieldIndex() = %v, want %v", out, want)
+	}
+}
+
+func TestStructFieldIndexShallowWins(t *testing.T) {
+	type Inner struct {
+		Name string
+	}
+	type Outer struct {
+		Inner
+		Name string
+	}
+
+	out := structFieldIndex(reflect.TypeOf(Outer{}), nil, make(map[string][]int))
+	if !reflect.DeepEqual(out["name"], []int{1}) {
+		t.Fatalf("structFieldIndex()[\"name\"] = %v, want the outer field (index [1])", out["name"])
+	}
+}
+
+func TestFieldByIndexAllocatesNilEmbeddedPointer(t *testing.T) {
+	type Address struct {
+		City string
+	}
+	type User struct {
+		*Address
+		Name string
+	}
+
+	v := reflect.New(reflect.TypeOf(User{})).Elem()
+	f := fieldByIndex(v, []int{0, 0})
+	f.SetString("nyc")
+
+	u := v.Interface().(User)
+	if u.Address == nil || u.Address.City != "nyc" {
+		t.Fatalf("fieldByIndex() did not allocate embedded pointer: %+v", u)
+	}
+}
+
+func TestFieldIndexesCachesByColumnSet(t *testing.T) {
+	type Row struct {
+		ID   int `db:"id"`
+		Name string
+	}
+	typ := reflect.TypeOf(Row{})
+
+	idx1, err := fieldIndexes(typ, []string{"id", "name"})
+	if err != nil {
+		t.Fatalf("fieldIndexes() error = %v", err)
+	}
+	if !reflect.DeepEqual(idx1, [][]int{{0}, {1}}) {
+		t.Fatalf("fieldIndexes() = %v", idx1)
+	}
+
+	idx2, err := fieldIndexes(typ, []string{"name", "id"})
+	if err != nil {
+		t.Fatalf("fieldIndexes() error = %v", err)
+	}
+	if !reflect.DeepEqual(idx2, [][]int{{1}, {0}}) {
+		t.Fatalf("fieldIndexes() with reordered columns = %v", idx2)
+	}
+
+	if _, err := fieldIndexes(typ, []string{"missing"}); err == nil {
+		t.Fatal("fieldIndexes() error = nil, want error for unknown column")
+	}
+}
+
+func TestFieldIndexesScannerField(t *testing.T) {
+	type Row struct {
+		Name sql.NullString
+	}
+	typ := reflect.TypeOf(Row{})
+
+	idx, err := fieldIndexes(typ, []string{"name"})
+	if err != nil {
+		t.Fatalf("fieldIndexes() error = %v", err)
+	}
+	if !reflect.DeepEqual(idx, [][]int{{0}}) {
+		t.Fatalf("fieldIndexes() = %v", idx)
+	}
+}
+
+func TestGetScansFirstRow(t *testing.T) {
+	type User struct {
+		ID   int    `db:"id"`
+		Name string
+	}
+
+	db, conn := newFakeDB(t)
+	conn.queryFunc = func(query string, args []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			cols: []string{"id", "name"},
+			data: [][]driver.Value{{int64(1), "bouk"}, {int64(2), "other"}},
+		}, nil
+	}
+
+	var u User
+	ctx := With(context.Background(), db)
+	if err := Get(ctx, &u, "SELECT id, name FROM users WHERE id = ?", 1); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if u.ID != 1 || u.Name != "bouk" {
+		t.Fatalf("Get() scanned %+v, want {1 bouk}", u)
+	}
+}
+
+func TestGetNoRowsReturnsErrNoRows(t *testing.T) {
+	type User struct {
+		ID int `db:"id"`
+	}
+
+	db, _ := newFakeDB(t)
+	var u User
+	ctx := With(context.Background(), db)
+	err := Get(ctx, &u, "SELECT id FROM users WHERE id = ?", 1)
+	if err != sql.ErrNoRows {
+		t.Fatalf("Get() error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSelectScansAllRows(t *testing.T) {
+	type User struct {
+		ID   int    `db:"id"`
+		Name string
+	}
+
+	db, conn := newFakeDB(t)
+	conn.queryFunc = func(query string, args []driver.Value) (driver.Rows, error) {
+		return &fakeRows{
+			cols: []string{"id", "name"},
+			data: [][]driver.Value{{int64(1), "bouk"}, {int64(2), "other"}},
+		}, nil
+	}
+
+	var users []User
+	ctx := With(context.Background(), db)
+	if err := Select(ctx, &users, "SELECT id, name FROM users"); err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	want := []User{{ID: 1, Name: "bouk"}, {ID: 2, Name: "other"}}
+	if !reflect.DeepEqual(users, want) {
+		t.Fatalf("Select() = %+v, want %+v", users, want)
+	}
+}
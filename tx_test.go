@@ -0,0 +1,225 @@
+package ctxdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeDB is a Databaser that records the queries it was asked to execute.
+// It deliberately does not implement beginTxer.
+type fakeDB struct {
+	execs []string
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.execs = append(f.execs, query)
+	return nil, nil
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+// fakeTxDB additionally implements beginTxer, so it satisfies TxDatabaser.
+type fakeTxDB struct {
+	fakeDB
+}
+
+func (f *fakeTxDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return nil, nil
+}
+
+func TestInTx(t *testing.T) {
+	ctx := context.Background()
+	if InTx(ctx) {
+		t.Fatal("InTx() = true on a plain context")
+	}
+
+	ctx = context.WithValue(ctx, inTxKey{}, true)
+	if !InTx(ctx) {
+		t.Fatal("InTx() = false after setting inTxKey")
+	}
+}
+
+func TestGetTxDBPrefersTxDatabaser(t *testing.T) {
+	main := &fakeDB{}
+	txDB := &fakeTxDB{}
+
+	ctx := With(context.Background(), main)
+	ctx = WithTxDB(ctx, txDB)
+
+	got, ok := getTxDB(ctx)
+	if !ok {
+		t.Fatal("getTxDB() ok = false, want true")
+	}
+	if got != beginTxer(txDB) {
+		t.Fatalf("getTxDB() = %v, want the registered tx-pool Databaser", got)
+	}
+}
+
+func TestGetTxDBFallsBackWhenUnset(t *testing.T) {
+	ctx := With(context.Background(), &fakeDB{})
+	if _, ok := getTxDB(ctx); ok {
+		t.Fatal("getTxDB() ok = true without WithTxDB")
+	}
+}
+
+func nestedTxCtx(db Databaser) context.Context {
+	ctx := With(context.Background(), db)
+	ctx = context.WithValue(ctx, inTxKey{}, true)
+	ctx = context.WithValue(ctx, savepointKey{}, new(int32))
+	return ctx
+}
+
+func TestNestedTxCommitsSavepointOnSuccess(t *testing.T) {
+	db := &fakeDB{}
+	ctx := nestedTxCtx(db)
+
+	err := nestedTx(ctx, func(ctx context.Context) error { return nil })
+	if err != nil {
+		t.Fatalf("nestedTx() error = %v", err)
+	}
+
+	want := []string{"SAVEPOINT ctxdb_sp_1", "RELEASE SAVEPOINT ctxdb_sp_1"}
+	if !reflect.DeepEqual(db.execs, want) {
+		t.Fatalf("execs = %v, want %v", db.execs, want)
+	}
+}
+
+func TestNestedTxRollsBackSavepointOnError(t *testing.T) {
+	db := &fakeDB{}
+	ctx := nestedTxCtx(db)
+	wantErr := errCantTx
+
+	err := nestedTx(ctx, func(ctx context.Context) error { return wantErr })
+	if err != wantErr {
+		t.Fatalf("nestedTx() error = %v, want %v", err, wantErr)
+	}
+
+	want := []string{"SAVEPOINT ctxdb_sp_1", "ROLLBACK TO SAVEPOINT ctxdb_sp_1"}
+	if !reflect.DeepEqual(db.execs, want) {
+		t.Fatalf("execs = %v, want %v", db.execs, want)
+	}
+}
+
+func TestNestedTxRollbackSentinelReturnsNil(t *testing.T) {
+	db := &fakeDB{}
+	ctx := nestedTxCtx(db)
+
+	err := nestedTx(ctx, func(ctx context.Context) error { return Rollback })
+	if err != nil {
+		t.Fatalf("nestedTx() error = %v, want nil for ctxdb.Rollback", err)
+	}
+
+	want := []string{"SAVEPOINT ctxdb_sp_1", "ROLLBACK TO SAVEPOINT ctxdb_sp_1"}
+	if !reflect.DeepEqual(db.execs, want) {
+		t.Fatalf("execs = %v, want %v", db.execs, want)
+	}
+}
+
+func TestNestedTxUsesUniqueSavepointNames(t *testing.T) {
+	db := &fakeDB{}
+	ctx := nestedTxCtx(db)
+
+	if err := nestedTx(ctx, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("nestedTx() error = %v", err)
+	}
+	if err := nestedTx(ctx, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("nestedTx() error = %v", err)
+	}
+
+	want := []string{
+		"SAVEPOINT ctxdb_sp_1", "RELEASE SAVEPOINT ctxdb_sp_1",
+		"SAVEPOINT ctxdb_sp_2", "RELEASE SAVEPOINT ctxdb_sp_2",
+	}
+	if !reflect.DeepEqual(db.execs, want) {
+		t.Fatalf("execs = %v, want %v", db.execs, want)
+	}
+}
+
+func TestTxCommitsOnSuccess(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	err := Tx(ctx, func(ctx context.Context) error {
+		_, err := Exec(ctx, "INSERT INTO users (name) VALUES (?)", "bouk")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Tx() error = %v", err)
+	}
+
+	execs, _ := conn.callLog()
+	if len(execs) != 2 || execs[0].query != "INSERT INTO users (name) VALUES (?)" || execs[1].query != "COMMIT" {
+		t.Fatalf("execs = %v, want [INSERT... COMMIT]", execs)
+	}
+}
+
+func TestTxRollsBackOnError(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+	wantErr := errors.New("boom")
+
+	err := Tx(ctx, func(ctx context.Context) error { return wantErr })
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Tx() error = %v, want it to wrap %v", err, wantErr)
+	}
+
+	execs, _ := conn.callLog()
+	if len(execs) != 1 || execs[0].query != "ROLLBACK" {
+		t.Fatalf("execs = %v, want [ROLLBACK]", execs)
+	}
+}
+
+func TestTxPrefersTxPoolDatabaser(t *testing.T) {
+	main := &fakeDB{} // does not implement beginTxer
+	txDB, txConn := newFakeDB(t)
+
+	ctx := With(context.Background(), main)
+	ctx = WithTxDB(ctx, txDB)
+
+	if err := Tx(ctx, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("Tx() error = %v", err)
+	}
+
+	execs, _ := txConn.callLog()
+	if len(execs) != 1 || execs[0].query != "COMMIT" {
+		t.Fatalf("execs on tx pool = %v, want [COMMIT]", execs)
+	}
+	if len(main.execs) != 0 {
+		t.Fatalf("Tx used the main Databaser instead of the tx pool: %v", main.execs)
+	}
+}
+
+func TestTxNestedCallProducesSavepoint(t *testing.T) {
+	db, conn := newFakeDB(t)
+	ctx := With(context.Background(), db)
+
+	err := Tx(ctx, func(ctx context.Context) error {
+		return Tx(ctx, func(ctx context.Context) error {
+			_, err := Exec(ctx, "UPDATE users SET name = ?", "bouk")
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("Tx() error = %v", err)
+	}
+
+	execs, _ := conn.callLog()
+	want := []string{"SAVEPOINT ctxdb_sp_1", "UPDATE users SET name = ?", "RELEASE SAVEPOINT ctxdb_sp_1", "COMMIT"}
+	if len(execs) != len(want) {
+		t.Fatalf("execs = %v, want %v", execs, want)
+	}
+	for i, w := range want {
+		if execs[i].query != w {
+			t.Fatalf("execs = %v, want %v", execs, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ctxdb
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// TxDatabaser is a Databaser that can also begin transactions. It is used to
+// register a connection pool dedicated to BeginTx, separate from the one
+// used for ordinary Exec/Query calls, via WithTxDB.
+type TxDatabaser interface {
+	Databaser
+	beginTxer
+}
+
+type txDBKey struct{}
+
+// WithTxDB returns a new context that, alongside the Databaser set by With,
+// carries a TxDatabaser reserved for starting transactions. Tx prefers txDB
+// over the Databaser in ctx when beginning a new transaction, which avoids
+// the classic deadlock where a handler holding a transaction's connection
+// also issues a non-transactional Query against the same exhausted pool.
+func WithTxDB(ctx context.Context, txDB TxDatabaser) context.Context {
+	return context.WithValue(ctx, txDBKey{}, txDB)
+}
+
+func getTxDB(ctx context.Context) (beginTxer, bool) {
+	db, ok := ctx.Value(txDBKey{}).(beginTxer)
+	return db, ok
+}
+
+type inTxKey struct{}
+
+// InTx reports whether ctx is currently inside a Tx callback.
+func InTx(ctx context.Context) bool {
+	v, _ := ctx.Value(inTxKey{}).(bool)
+	return v
+}
+
+type txIDKey struct{}
+
+var txIDCounter int64
+
+// newTxID returns a process-unique id for a new transaction, used to
+// correlate queries issued within it (see SpanAttributes.TxID).
+func newTxID() string {
+	return fmt.Sprintf("tx-%d", atomic.AddInt64(&txIDCounter, 1))
+}
+
+func getTxID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(txIDKey{}).(string)
+	return id, ok
+}
+
+type savepointKey struct{}
+
+// nestedTx converts a Tx call made from inside another Tx's callback into a
+// SAVEPOINT, rather than attempting to begin a new transaction on the
+// *sql.Tx in ctx, which does not implement BeginTx.
+func nestedTx(ctx context.Context, f func(ctx context.Context) error) error {
+	counter, ok := ctx.Value(savepointKey{}).(*int32)
+	if !ok {
+		return errCantTx
+	}
+	name := fmt.Sprintf("ctxdb_sp_%d", atomic.AddInt32(counter, 1))
+
+	if _, err := Exec(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	if err := f(ctx); err != nil {
+		if _, rbErr := Exec(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return rbErr
+		}
+		if err == Rollback {
+			return nil
+		}
+		return err
+	}
+
+	_, err := Exec(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}